@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+func main() {
+	in := flag.String("in", "", "file or directory to create a torrent from")
+	tracker := flag.String("tracker", "", "announce URL")
+	pieceSize := flag.Int("piece-size", 262144, "piece size in bytes")
+	out := flag.String("out", "out.torrent", "path to write the .torrent file to")
+	flag.Parse()
+
+	if *in == "" || *tracker == "" {
+		fmt.Fprintln(os.Stderr, "usage: torrent-create -in <path> -tracker <url> [-piece-size 262144] [-out foo.torrent]")
+		os.Exit(1)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	b := torrent.NewBuilder(*tracker, *pieceSize)
+	if err := b.Build(*in, f); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,17 @@
+package dht
+
+import (
+	"errors"
+
+	"github.com/bkolad/gTorrent/internal/bencodevalue"
+)
+
+// decodeDict decodes b as a single top-level bencoded dict, which is the
+// shape every KRPC message takes.
+func decodeDict(b []byte) (map[string]interface{}, []byte, error) {
+	dict, rest, err := bencodevalue.DecodeDict(b)
+	if err != nil {
+		return nil, nil, errors.New("dht: " + err.Error())
+	}
+	return dict, rest, nil
+}
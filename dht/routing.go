@@ -0,0 +1,140 @@
+package dht
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+)
+
+// numBuckets is the number of bits in a NodeID -- one bucket per possible
+// highest-differing bit, per BEP 5.
+const numBuckets = 160
+
+// bucketSize is k, the maximum number of contacts a bucket holds.
+const bucketSize = 8
+
+// NodeID is a node's 160-bit identifier, also used as the XOR distance
+// metric between nodes.
+type NodeID [20]byte
+
+func (id NodeID) distance(other NodeID) NodeID {
+	var d NodeID
+	for i := range id {
+		d[i] = id[i] ^ other[i]
+	}
+	return d
+}
+
+func (id NodeID) less(other NodeID) bool {
+	return bytes.Compare(id[:], other[:]) < 0
+}
+
+// node is one contact known to the routing table.
+type node struct {
+	id   NodeID
+	addr *net.UDPAddr
+}
+
+type bucket struct {
+	nodes []*node
+}
+
+// routingTable is the Kademlia-style routing table: 160 buckets of up to
+// bucketSize nodes each, bucket i holding every known node whose XOR
+// distance to the local id has bit i as its highest set bit.
+type routingTable struct {
+	mu      sync.Mutex
+	localID NodeID
+	buckets [numBuckets]bucket
+}
+
+func newRoutingTable(id NodeID) *routingTable {
+	return &routingTable{localID: id}
+}
+
+// bucketIndex returns the index of the highest bit at which id differs
+// from the local node id.
+func (rt *routingTable) bucketIndex(id NodeID) int {
+	dist := rt.localID.distance(id)
+	for i, b := range dist {
+		if b == 0 {
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>uint(bit)) != 0 {
+				return i*8 + bit
+			}
+		}
+	}
+	return numBuckets - 1
+}
+
+// insert adds or refreshes a contact. A full bucket silently drops the
+// new contact -- health-checking and evicting stale entries to make room
+// is Server's job (see Server.checkStaleNodesLoop), since that requires
+// pinging over the network.
+func (rt *routingTable) insert(n *node) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b := &rt.buckets[rt.bucketIndex(n.id)]
+	for i, existing := range b.nodes {
+		if existing.id == n.id {
+			b.nodes[i] = n
+			return
+		}
+	}
+
+	if len(b.nodes) < bucketSize {
+		b.nodes = append(b.nodes, n)
+	}
+}
+
+// remove evicts a contact that failed a health check.
+func (rt *routingTable) remove(id NodeID) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b := &rt.buckets[rt.bucketIndex(id)]
+	for i, existing := range b.nodes {
+		if existing.id == id {
+			b.nodes = append(b.nodes[:i], b.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// oldest returns every bucket's first-added node (refreshing a contact via
+// insert doesn't move it), i.e. the candidates a periodic health check
+// should ping first.
+func (rt *routingTable) oldest() []*node {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var out []*node
+	for _, b := range rt.buckets {
+		if len(b.nodes) > 0 {
+			out = append(out, b.nodes[0])
+		}
+	}
+	return out
+}
+
+// closest returns the k nodes in the table nearest to target.
+func (rt *routingTable) closest(target NodeID, k int) []*node {
+	rt.mu.Lock()
+	var all []*node
+	for _, b := range rt.buckets {
+		all = append(all, b.nodes...)
+	}
+	rt.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].id.distance(target).less(all[j].id.distance(target))
+	})
+	if len(all) > k {
+		all = all[:k]
+	}
+	return all
+}
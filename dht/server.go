@@ -0,0 +1,358 @@
+// Package dht implements enough of BEP 5 (the Mainline DHT) for
+// trackerless peer discovery: a routing table of other nodes, and the
+// iterative get_peers/announce_peer KRPC lookup used to find peers for
+// an info hash without ever talking to a tracker.
+package dht
+
+import (
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// bootstrapNodes are well-known routers used to seed the routing table
+// when a Server starts with no known contacts.
+var bootstrapNodes = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+}
+
+const (
+	queryTimeout     = 5 * time.Second
+	staleCheckPeriod = 15 * time.Minute
+)
+
+// Conf configures a Server.
+type Conf struct {
+	// Port is the UDP port to listen on; 0 picks an ephemeral port.
+	Port int
+}
+
+// Server is a DHT node: it answers other nodes' queries, keeps a routing
+// table current, and can look up peers for an info hash on behalf of the
+// local client.
+type Server struct {
+	conn  *net.UDPConn
+	id    NodeID
+	table *routingTable
+
+	mu      sync.Mutex
+	pending map[string]chan map[string]interface{}
+}
+
+// NewServer starts a DHT node bound to conf.Port and begins bootstrapping
+// its routing table from the well-known routers in the background.
+func NewServer(conf Conf) (*Server, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: conf.Port})
+	if err != nil {
+		return nil, err
+	}
+
+	id := randomNodeID()
+	s := &Server{
+		conn:    conn,
+		id:      id,
+		table:   newRoutingTable(id),
+		pending: map[string]chan map[string]interface{}{},
+	}
+
+	go s.readLoop()
+	go s.bootstrap()
+	go s.checkStaleNodesLoop()
+
+	return s, nil
+}
+
+func randomNodeID() NodeID {
+	var id NodeID
+	rand.Read(id[:])
+	return id
+}
+
+func (s *Server) bootstrap() {
+	s.queryBootstrapNodes(s.id)
+}
+
+// queryBootstrapNodes runs find_node against every well-known router for
+// target, learning whatever contacts answer into the routing table, and
+// returns the table's current closest nodes to target. GetPeers calls
+// this directly whenever the table doesn't yet have anything closer than
+// nothing to offer -- most commonly right after startup, before the
+// background bootstrap goroutine has heard back from anyone.
+func (s *Server) queryBootstrapNodes(target NodeID) []*node {
+	for _, addr := range bootstrapNodes {
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			continue
+		}
+		s.findNode(raddr, target)
+	}
+	return s.table.closest(target, bucketSize)
+}
+
+// checkStaleNodesLoop periodically pings each bucket's oldest contact and
+// evicts it if it doesn't answer, freeing the slot for fresher nodes.
+func (s *Server) checkStaleNodesLoop() {
+	for range time.Tick(staleCheckPeriod) {
+		for _, n := range s.table.oldest() {
+			if _, err := s.query(n.addr, "ping", map[string]interface{}{}); err != nil {
+				s.table.remove(n.id)
+			}
+		}
+	}
+}
+
+// GetPeers performs the iterative get_peers lookup (BEP 5) for infoHash,
+// streaming every peer discovered along the way. The channel is closed
+// once the lookup converges on no closer unqueried nodes.
+func (s *Server) GetPeers(infoHash [20]byte) <-chan torrent.PeerInfo {
+	out := make(chan torrent.PeerInfo, 32)
+
+	go func() {
+		defer close(out)
+
+		target := NodeID(infoHash)
+		queried := map[NodeID]bool{}
+		frontier := s.table.closest(target, bucketSize)
+		if len(frontier) == 0 {
+			// The background bootstrap goroutine may not have heard back
+			// from anyone yet (or ever, for a table that's gone stale) --
+			// query the well-known routers directly rather than reporting
+			// an empty lookup.
+			frontier = s.queryBootstrapNodes(target)
+		}
+
+		for len(frontier) > 0 {
+			var next []*node
+			for _, n := range frontier {
+				if queried[n.id] {
+					continue
+				}
+				queried[n.id] = true
+
+				rsp, err := s.query(n.addr, "get_peers", map[string]interface{}{
+					"info_hash": string(infoHash[:]),
+				})
+				if err != nil {
+					continue
+				}
+
+				s.emitPeers(rsp, out)
+				s.learnNodes(rsp)
+				if token := responseToken(rsp); token != "" {
+					go s.announcePeer(n.addr, infoHash, token)
+				}
+				next = append(next, s.table.closest(target, bucketSize)...)
+			}
+			frontier = unqueried(next, queried)
+		}
+	}()
+
+	return out
+}
+
+func (s *Server) emitPeers(rsp map[string]interface{}, out chan<- torrent.PeerInfo) {
+	r, _ := rsp["r"].(map[string]interface{})
+	if r == nil {
+		return
+	}
+
+	values, _ := r["values"].([]interface{})
+	for _, v := range values {
+		compact, ok := v.(string)
+		if !ok || len(compact) != 6 {
+			continue
+		}
+		ip := net.IP([]byte(compact[:4]))
+		port := int(compact[4])<<8 | int(compact[5])
+		out <- torrent.PeerInfo{IP: ip.String(), Port: port}
+	}
+}
+
+// responseToken extracts the announce token a get_peers response handed
+// back, if any -- nodes that don't keep a peer store (this one included,
+// see handleQuery) omit it.
+func responseToken(rsp map[string]interface{}) string {
+	r, _ := rsp["r"].(map[string]interface{})
+	if r == nil {
+		return ""
+	}
+	token, _ := r["token"].(string)
+	return token
+}
+
+// announcePeer tells addr that the local node has (or will shortly have)
+// peers for infoHash, using the token addr handed back in its get_peers
+// response, per BEP 5. implied_port asks addr to record this query's UDP
+// source port rather than trust a port argument, since the DHT node has
+// no idea which TCP port, if any, the wire-protocol peer is listening on.
+func (s *Server) announcePeer(addr *net.UDPAddr, infoHash [20]byte, token string) {
+	s.query(addr, "announce_peer", map[string]interface{}{
+		"info_hash":    string(infoHash[:]),
+		"implied_port": 1,
+		"port":         0,
+		"token":        token,
+	})
+}
+
+func unqueried(nodes []*node, queried map[NodeID]bool) []*node {
+	var out []*node
+	seen := map[NodeID]bool{}
+	for _, n := range nodes {
+		if queried[n.id] || seen[n.id] {
+			continue
+		}
+		seen[n.id] = true
+		out = append(out, n)
+	}
+	return out
+}
+
+func (s *Server) findNode(addr *net.UDPAddr, target NodeID) {
+	rsp, err := s.query(addr, "find_node", map[string]interface{}{"target": string(target[:])})
+	if err != nil {
+		return
+	}
+	s.learnNodes(rsp)
+}
+
+// learnNodes parses a response's compact "nodes" field (20-byte id +
+// 4-byte IPv4 + 2-byte port per entry) and adds every contact to the
+// routing table.
+func (s *Server) learnNodes(rsp map[string]interface{}) {
+	r, _ := rsp["r"].(map[string]interface{})
+	if r == nil {
+		return
+	}
+
+	compact, _ := r["nodes"].(string)
+	for i := 0; i+26 <= len(compact); i += 26 {
+		var id NodeID
+		copy(id[:], compact[i:i+20])
+		ip := net.IP([]byte(compact[i+20 : i+24]))
+		port := int(compact[i+24])<<8 | int(compact[i+25])
+		s.table.insert(&node{id: id, addr: &net.UDPAddr{IP: ip, Port: port}})
+	}
+}
+
+func (s *Server) readLoop() {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		msg, _, err := decodeDict(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		if y, _ := msg["y"].(string); y == "q" {
+			s.handleQuery(msg, addr)
+			continue
+		}
+
+		txID, _ := msg["t"].(string)
+		s.mu.Lock()
+		ch, ok := s.pending[txID]
+		s.mu.Unlock()
+		if ok {
+			// ch is buffered 1 and read at most once, by the query()
+			// call that's still waiting on it -- a retransmitted or
+			// colliding-txid response arriving after that call already
+			// returned (and deleted the map entry, but not before this
+			// lookup read it) must not block here, or it wedges every
+			// later response this Server ever reads.
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// handleQuery answers another node's ping/find_node/get_peers/
+// announce_peer query. The server doesn't keep a peer store of its own,
+// so get_peers always answers with the closest known nodes rather than
+// values.
+func (s *Server) handleQuery(msg map[string]interface{}, addr *net.UDPAddr) {
+	q, _ := msg["q"].(string)
+	a, _ := msg["a"].(map[string]interface{})
+	txID, _ := msg["t"].(string)
+
+	r := map[string]interface{}{"id": string(s.id[:])}
+	switch q {
+	case "ping", "announce_peer":
+	case "find_node", "get_peers":
+		r["nodes"] = s.compactClosestNodes(a)
+	default:
+		return
+	}
+
+	s.send(map[string]interface{}{"t": txID, "y": "r", "r": r}, addr)
+}
+
+func (s *Server) compactClosestNodes(a map[string]interface{}) string {
+	targetStr, _ := a["target"].(string)
+	if targetStr == "" {
+		targetStr, _ = a["info_hash"].(string)
+	}
+
+	var target NodeID
+	copy(target[:], targetStr)
+
+	buf := make([]byte, 0, bucketSize*26)
+	for _, n := range s.table.closest(target, bucketSize) {
+		buf = append(buf, n.id[:]...)
+		buf = append(buf, n.addr.IP.To4()...)
+		buf = append(buf, byte(n.addr.Port>>8), byte(n.addr.Port))
+	}
+	return string(buf)
+}
+
+func (s *Server) query(addr *net.UDPAddr, q string, args map[string]interface{}) (map[string]interface{}, error) {
+	txID := randomTxID()
+	args["id"] = string(s.id[:])
+
+	ch := make(chan map[string]interface{}, 1)
+	s.mu.Lock()
+	s.pending[txID] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, txID)
+		s.mu.Unlock()
+	}()
+
+	msg := map[string]interface{}{"t": txID, "y": "q", "q": q, "a": args}
+	if err := s.send(msg, addr); err != nil {
+		return nil, err
+	}
+
+	select {
+	case rsp := <-ch:
+		return rsp, nil
+	case <-time.After(queryTimeout):
+		return nil, errors.New("dht: query to " + addr.String() + " timed out")
+	}
+}
+
+func (s *Server) send(msg map[string]interface{}, addr *net.UDPAddr) error {
+	encoded, err := torrent.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.WriteToUDP(encoded, addr)
+	return err
+}
+
+func randomTxID() string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return string(b)
+}
@@ -0,0 +1,65 @@
+// Package init builds the runtime Configuration and initial session
+// State main.go needs to start a download -- command-line flags in,
+// typed config out.
+package init
+
+import (
+	"flag"
+	"math/rand"
+)
+
+// Configuration holds the settings main.go needs to locate a torrent,
+// store it and talk to the swarm.
+type Configuration struct {
+	TorrentPath    string
+	DownloadDir    string
+	StorageBackend string
+	Port           int
+	PeerID         string
+}
+
+// State is the client's progress, reported to the tracker on every
+// announce (BEP 3's uploaded/downloaded/left).
+type State struct {
+	Uploaded   int
+	Downloaded int
+	Left       int
+}
+
+// NewConf parses the command line into a Configuration.
+func NewConf() Configuration {
+	torrentPath := flag.String("torrent", "", "path to a .torrent file or a magnet URI")
+	downloadDir := flag.String("dir", ".", "directory to download into")
+	storageBackend := flag.String("storage", "file", "storage backend: file, mmap or memory")
+	port := flag.Int("port", 6881, "TCP port to listen on for incoming peer connections")
+	flag.Parse()
+
+	return Configuration{
+		TorrentPath:    *torrentPath,
+		DownloadDir:    *downloadDir,
+		StorageBackend: *storageBackend,
+		Port:           *port,
+		PeerID:         randomPeerID(),
+	}
+}
+
+// NewInitState returns the zero-progress State a fresh download starts
+// from.
+func NewInitState() State {
+	return State{}
+}
+
+// peerIDPrefix identifies this client to trackers and peers, per the
+// Azureus-style convention BEP 20 describes.
+const peerIDPrefix = "-GT0001-"
+
+// randomPeerID generates a 20-byte peer id: peerIDPrefix followed by
+// enough random alphanumeric characters to fill it out.
+func randomPeerID() string {
+	const chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, 20-len(peerIDPrefix))
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return peerIDPrefix + string(b)
+}
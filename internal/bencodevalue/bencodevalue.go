@@ -0,0 +1,123 @@
+// Package bencodevalue decodes a single bencoded value into plain Go
+// values (int, string, []interface{}, map[string]interface{}).
+//
+// It exists alongside the typed bDict/bList/bInt/bStr decoder in the
+// torrent package: that decoder builds a tree callers walk with
+// intValue/strValue/fromDict helpers tailored to .torrent file shape,
+// which is overkill for the small, dynamically-shaped dicts exchanged by
+// the extended handshake / ut_metadata (BEP 9/10) and KRPC (BEP 5)
+// messages. Both of those just want "decode this into a map and type-
+// assert the fields I care about", so they share this decoder instead of
+// each hand-rolling their own.
+package bencodevalue
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Decode decodes a single bencoded value off the front of b, returning
+// the value alongside whatever of b wasn't consumed.
+func Decode(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errors.New("bencodevalue: unexpected end of bencoded value")
+	}
+
+	switch {
+	case b[0] == 'i':
+		end := indexByte(b, 'e')
+		if end < 0 {
+			return nil, nil, errors.New("bencodevalue: unterminated integer")
+		}
+		n, err := strconv.Atoi(string(b[1:end]))
+		if err != nil {
+			return nil, nil, err
+		}
+		return n, b[end+1:], nil
+
+	case b[0] == 'l':
+		rest := b[1:]
+		var list []interface{}
+		for len(rest) > 0 && rest[0] != 'e' {
+			var v interface{}
+			var err error
+			v, rest, err = Decode(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			list = append(list, v)
+		}
+		if len(rest) == 0 {
+			return nil, nil, errors.New("bencodevalue: unterminated list")
+		}
+		return list, rest[1:], nil
+
+	case b[0] == 'd':
+		rest := b[1:]
+		dict := map[string]interface{}{}
+		for len(rest) > 0 && rest[0] != 'e' {
+			var key interface{}
+			var err error
+			key, rest, err = Decode(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, nil, errors.New("bencodevalue: dict key is not a string")
+			}
+
+			var val interface{}
+			val, rest, err = Decode(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			dict[keyStr] = val
+		}
+		if len(rest) == 0 {
+			return nil, nil, errors.New("bencodevalue: unterminated dict")
+		}
+		return dict, rest[1:], nil
+
+	case b[0] >= '0' && b[0] <= '9':
+		colon := indexByte(b, ':')
+		if colon < 0 {
+			return nil, nil, errors.New("bencodevalue: malformed string length")
+		}
+		n, err := strconv.Atoi(string(b[:colon]))
+		if err != nil {
+			return nil, nil, err
+		}
+		start := colon + 1
+		if start+n > len(b) {
+			return nil, nil, errors.New("bencodevalue: string runs past end of message")
+		}
+		return string(b[start : start+n]), b[start+n:], nil
+
+	default:
+		return nil, nil, errors.New("bencodevalue: unrecognized bencode token")
+	}
+}
+
+// DecodeDict decodes b as a single top-level bencoded dict, which is the
+// shape both KRPC messages and LTEP extension messages take.
+func DecodeDict(b []byte) (map[string]interface{}, []byte, error) {
+	v, rest, err := Decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, nil, errors.New("bencodevalue: message is not a dict")
+	}
+	return dict, rest, nil
+}
+
+func indexByte(b []byte, c byte) int {
+	for i, v := range b {
+		if v == c {
+			return i
+		}
+	}
+	return -1
+}
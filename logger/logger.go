@@ -0,0 +1,13 @@
+// Package logger is the one place gTorrent writes diagnostic output,
+// so the wire-protocol and extension code can log without every package
+// picking its own convention for where that output goes.
+package logger
+
+import "log"
+
+// Debug logs msg. It's the only level anything in the tree needs so
+// far: peer-connection chatter that's noise in the common case but
+// useful when a download stalls.
+func Debug(msg string) {
+	log.Println(msg)
+}
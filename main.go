@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
 
 	i "github.com/bkolad/gTorrent/init"
 
-	"github.com/bkolad/gTorrent/network"
+	"github.com/bkolad/gTorrent/dht"
+	log "github.com/bkolad/gTorrent/logger"
 	p "github.com/bkolad/gTorrent/peer"
+	"github.com/bkolad/gTorrent/session"
+	"github.com/bkolad/gTorrent/storage"
 	"github.com/bkolad/gTorrent/torrent"
 	"github.com/bkolad/gTorrent/tracker"
 )
@@ -15,14 +21,8 @@ import (
 func main() {
 	conf := i.NewConf()
 	initState := i.NewInitState()
-	data, err := ioutil.ReadFile(conf.TorrentPath)
-	if err != nil {
-		fmt.Println("File reading error", err)
-		return
-	}
-	dec := torrent.NewTorrentDecoder(string(data))
-	info, err := dec.Decode()
 
+	info, err := decodeTorrent(conf.TorrentPath)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -31,14 +31,126 @@ func main() {
 	tracker, _ := tracker.NewTracker(info, initState, conf)
 
 	peers, err := tracker.Peers()
+	if err != nil || len(peers) == 0 {
+		fmt.Println("tracker unavailable, falling back to DHT:", err)
+		peers, err = dhtPeers(info)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	backend, err := newStorage(conf, info)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	picker := p.NewPiecePicker(info, p.Sequential)
+	sess := session.NewSession(info, backend, picker)
+
 	h := p.NewHandshake(conf, info)
+	for _, peerInfo := range peers {
+		connectPeer(*peerInfo, h, info, backend, picker)
+	}
+
+	if err := download(sess, info); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// download drains every file in the torrent through a streaming Reader,
+// which is what actually drives pieces to completion: each Read blocks
+// until the picker and a connected peer deliver the piece it needs, in
+// file order, so this returns once the whole torrent is on disk.
+func download(sess *session.Session, info *torrent.Info) error {
+	numFiles := 1
+	if files := info.Files(); files != nil {
+		numFiles = len(files)
+	}
+
+	for i := 0; i < numFiles; i++ {
+		reader, err := sess.NewReader(i)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(ioutil.Discard, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectPeer starts a download connection to peerInfo and logs whatever
+// comes back on its message channel (handshake failures and the like) --
+// main doesn't otherwise need to react to a single peer dropping out, the
+// shared picker just stops offering it work.
+func connectPeer(peerInfo torrent.PeerInfo, h p.Handshake, info *torrent.Info, backend storage.Storage, picker *p.PiecePicker) {
+	messages := make(chan p.MSG, 8)
+	p.NewDownloadPeer(messages, peerInfo, h, info, backend, picker)
 
-	net := network.NewNetwork(peers[0], h)
-	net.Send()
+	go func() {
+		for msg := range messages {
+			log.Debug(fmt.Sprintf("peer %s: %v", peerInfo.IP, msg))
+		}
+	}()
+}
+
+// dhtPeers falls back to the DHT (BEP 5) once every tracker in the
+// announce-list has failed, returning the first peer it finds for info's
+// info hash.
+func dhtPeers(info *torrent.Info) ([]*torrent.PeerInfo, error) {
+	srv, err := dht.NewServer(dht.Conf{})
+	if err != nil {
+		return nil, err
+	}
+
+	var infoHash [20]byte
+	copy(infoHash[:], info.InfoHash)
+
+	var peers []*torrent.PeerInfo
+	for peer := range srv.GetPeers(infoHash) {
+		peer := peer
+		peers = append(peers, &peer)
+		break
+	}
+	if len(peers) == 0 {
+		return nil, errors.New("DHT found no peers")
+	}
+	return peers, nil
+}
+
+// newStorage picks the storage backend named by conf.StorageBackend
+// ("mmap" or "memory", falling back to plain file-backed storage), so the
+// backend in use can be switched from the command line (-storage)
+// without touching this code again.
+func newStorage(conf i.Configuration, info *torrent.Info) (storage.Storage, error) {
+	switch conf.StorageBackend {
+	case "mmap":
+		return storage.NewMmap(conf.DownloadDir, info)
+	case "memory":
+		return storage.NewMemory(info), nil
+	default:
+		return storage.NewFile(conf.DownloadDir, info)
+	}
+}
+
+// decodeTorrent reads path as a .torrent file, or, if it's a magnet URI,
+// decodes it directly -- the returned Info is then missing everything
+// but InfoHash, Name and AnnounceList until a peer connection fetches the
+// rest over ut_metadata.
+func decodeTorrent(path string) (*torrent.Info, error) {
+	if strings.HasPrefix(path, "magnet:") {
+		return torrent.NewMagnetDecoder(path).Decode()
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("File reading error: %s", err)
+	}
 
+	return torrent.NewTorrentDecoder(string(data)).Decode()
 }
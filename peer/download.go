@@ -0,0 +1,41 @@
+package peer
+
+import (
+	"bytes"
+	"crypto/sha1"
+
+	"github.com/bkolad/gTorrent/storage"
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// NewDownloadPeer returns a Peer that writes received pieces through
+// backend, verifying each one against info.PieceHashes once it's fully
+// assembled (see simplePeer.onPiece), and requests chunks from the shared
+// picker as it gets unchoked and as pieces complete. The connection and
+// handshake are started in the background before it returns.
+func NewDownloadPeer(messages chan MSG, peerInfo torrent.PeerInfo, handshake Handshake, info *torrent.Info, backend storage.Storage, picker *PiecePicker) Peer {
+	p := newPeer(messages, peerInfo, handshake).(*simplePeer)
+	p.torrentInfo = info
+	p.storageBackend = backend
+	p.picker = picker
+	go p.start()
+	return p
+}
+
+// expectedPieceSize returns how many bytes the given piece should hold --
+// info.PieceSize for every piece but the last, which is usually shorter.
+func expectedPieceSize(info *torrent.Info, index int) int {
+	lastSize, numPieces := info.CalculateLastPieceSize()
+	if index == numPieces-1 {
+		return lastSize
+	}
+	return info.PieceSize
+}
+
+func verifyPiece(info *torrent.Info, index int, data []byte) bool {
+	if index < 0 || index >= len(info.PieceHashes) {
+		return false
+	}
+	sum := sha1.Sum(data)
+	return bytes.Equal(sum[:], info.PieceHashes[index])
+}
@@ -0,0 +1,231 @@
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/bkolad/gTorrent/internal/bencodevalue"
+	log "github.com/bkolad/gTorrent/logger"
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// BEP 10 reserves message id 20 for extended messages; within the payload
+// the first byte is the extended message id, 0 being the handshake.
+const extended = 20
+const extHandshakeID byte = 0
+
+const utMetadataName = "ut_metadata"
+const utMetadataLocalID byte = 1
+const metadataPieceSize = 16384
+
+// ut_metadata message types, see BEP 9.
+const (
+	metadataRequest = 0
+	metadataData    = 1
+	metadataReject  = 2
+)
+
+// metadataTransfer tracks an in-flight fetch of the info dictionary over
+// the ut_metadata extension, used when the torrent was added from a
+// magnet link and most of torrent.Info is still unknown.
+type metadataTransfer struct {
+	info     *torrent.Info
+	size     int
+	pieces   [][]byte
+	received int
+	peerUTID byte
+	done     func(*torrent.Info, error)
+}
+
+// NewMetadataPeer returns a Peer that performs the regular wire protocol
+// handshake plus the LTEP extended handshake, and fetches the full info
+// dictionary for infoHash from the peer via ut_metadata (BEP 9/10) before
+// calling done. Peers that don't advertise ut_metadata support are
+// reported through done and otherwise left alone -- callers are expected
+// to silently move on to the next peer.
+func NewMetadataPeer(messages chan MSG, peerInfo torrent.PeerInfo, handshake Handshake, infoHash []byte, done func(*torrent.Info, error)) Peer {
+	p := newPeer(messages, peerInfo, handshake).(*simplePeer)
+	p.metadata = &metadataTransfer{info: &torrent.Info{InfoHash: infoHash}, done: done}
+	go p.start()
+	return p
+}
+
+func (p *simplePeer) sendExtendedHandshake() {
+	p.send(encodeExtended(extHandshakeID, encodeExtHandshakeBody()))
+}
+
+func (p *simplePeer) onExtended(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+
+	id, body := payload[0], payload[1:]
+
+	switch id {
+	case extHandshakeID:
+		p.onExtendedHandshake(body)
+	case utMetadataLocalID:
+		p.onUTMetadata(body)
+	}
+}
+
+func (p *simplePeer) onExtendedHandshake(body []byte) {
+	handshake, err := decodeExtHandshake(body)
+	if err != nil {
+		log.Debug("bad extended handshake: " + err.Error())
+		return
+	}
+	p.peerExtensions = handshake.m
+
+	if p.metadata == nil {
+		return
+	}
+
+	peerUTID, ok := handshake.m[utMetadataName]
+	if !ok {
+		p.metadata.done(nil, errors.New("peer does not support ut_metadata"))
+		p.metadata = nil
+		return
+	}
+	p.metadata.peerUTID = peerUTID
+
+	if handshake.metadataSize <= 0 {
+		return
+	}
+	p.metadata.size = handshake.metadataSize
+	numPieces := (handshake.metadataSize + metadataPieceSize - 1) / metadataPieceSize
+	p.metadata.pieces = make([][]byte, numPieces)
+	p.requestMetadataPieces()
+}
+
+func (p *simplePeer) requestMetadataPieces() {
+	for i, piece := range p.metadata.pieces {
+		if piece != nil {
+			continue
+		}
+		body := encodeBencodeDict(map[string]int{"msg_type": metadataRequest, "piece": i})
+		p.send(encodeExtended(p.metadata.peerUTID, body))
+	}
+}
+
+func (p *simplePeer) onUTMetadata(body []byte) {
+	if p.metadata == nil {
+		return
+	}
+
+	msgType, piece, dataStart, err := decodeMetadataHeader(body)
+	if err != nil {
+		log.Debug("bad ut_metadata message: " + err.Error())
+		return
+	}
+
+	switch msgType {
+	case metadataReject:
+		log.Debug("peer rejected metadata piece " + strconv.Itoa(piece))
+	case metadataData:
+		if piece < 0 || piece >= len(p.metadata.pieces) {
+			return
+		}
+		p.metadata.pieces[piece] = body[dataStart:]
+		p.metadata.received++
+		if p.metadata.received == len(p.metadata.pieces) {
+			p.finishMetadata()
+		}
+	}
+}
+
+func (p *simplePeer) finishMetadata() {
+	raw := bytes.Join(p.metadata.pieces, nil)
+	done := p.metadata.done
+	info := p.metadata.info
+	p.metadata = nil
+
+	if err := info.CompleteFromMetadata(raw); err != nil {
+		done(nil, err)
+		return
+	}
+	done(info, nil)
+}
+
+func encodeExtended(id byte, body []byte) Packet {
+	return newPacket(extended, append([]byte{id}, body...))
+}
+
+// The handful of bencode helpers below only need to cover the small,
+// fixed-shape dictionaries the extended handshake and ut_metadata
+// messages carry (BEP 9/10) -- ints, strings and dicts of those.
+
+func encodeExtHandshakeBody() []byte {
+	m := encodeBencodeDict(map[string]int{utMetadataName: int(utMetadataLocalID)})
+
+	var buf bytes.Buffer
+	buf.WriteByte('d')
+	buf.WriteString("1:m")
+	buf.Write(m)
+	buf.WriteByte('e')
+	return buf.Bytes()
+}
+
+func encodeBencodeDict(m map[string]int) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteByte('d')
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%d:%s", len(k), k)
+		fmt.Fprintf(&buf, "i%de", m[k])
+	}
+	buf.WriteByte('e')
+	return buf.Bytes()
+}
+
+type extHandshake struct {
+	m            map[string]byte
+	metadataSize int
+}
+
+func decodeExtHandshake(body []byte) (*extHandshake, error) {
+	v, _, err := bencodevalue.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("extended handshake is not a dictionary")
+	}
+
+	h := &extHandshake{m: map[string]byte{}}
+	if mDict, ok := dict["m"].(map[string]interface{}); ok {
+		for name, id := range mDict {
+			if n, ok := id.(int); ok {
+				h.m[name] = byte(n)
+			}
+		}
+	}
+	if size, ok := dict["metadata_size"].(int); ok {
+		h.metadataSize = size
+	}
+	return h, nil
+}
+
+func decodeMetadataHeader(body []byte) (msgType, piece, dataStart int, err error) {
+	v, rest, err := bencodevalue.Decode(body)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, 0, 0, errors.New("ut_metadata message is not a dictionary")
+	}
+
+	msgType, _ = dict["msg_type"].(int)
+	piece, _ = dict["piece"].(int)
+	return msgType, piece, len(body) - len(rest), nil
+}
@@ -0,0 +1,210 @@
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	i "github.com/bkolad/gTorrent/init"
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// MSG is whatever a Peer reports back on its message channel -- so far
+// just handshakeError, but callers (main.go's connectPeer) only ever log
+// it, so it doesn't need a richer shape yet.
+type MSG interface{}
+
+// handshakeError is sent on a Peer's message channel when the wire
+// protocol handshake fails.
+type handshakeError struct{}
+
+// PacketListener receives every Packet a Network reads off the wire
+// once the handshake has completed. simplePeer is the only
+// implementation.
+type PacketListener interface {
+	NewPacket(Packet)
+}
+
+// Network is the wire-protocol (BEP 3) connection to one peer: it owns
+// the TCP socket, performs the handshake, and dispatches every Packet it
+// reads to the registered PacketListener.
+type Network interface {
+	SendHandshake() error
+	Send(Packet)
+	RegisterListener(PacketListener)
+}
+
+const (
+	pstr             = "BitTorrent protocol"
+	handshakeTimeout = 10 * time.Second
+)
+
+// Handshake is the fixed part of the BEP 3 handshake message -- this
+// client's peer id and the info hash of the torrent being fetched --
+// shared by every peer connection main.go opens for a given download.
+type Handshake struct {
+	infoHash [20]byte
+	peerID   [20]byte
+}
+
+// NewHandshake builds the Handshake to send to every peer for info,
+// identifying this client as conf.PeerID.
+func NewHandshake(conf i.Configuration, info *torrent.Info) Handshake {
+	var h Handshake
+	copy(h.infoHash[:], info.InfoHash)
+	copy(h.peerID[:], conf.PeerID)
+	return h
+}
+
+type network struct {
+	peerInfo  torrent.PeerInfo
+	handshake Handshake
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	listener PacketListener
+}
+
+// NewNetwork returns a Network that will dial peerInfo and perform
+// handshake once SendHandshake is called.
+func NewNetwork(peerInfo torrent.PeerInfo, handshake Handshake) Network {
+	return &network{peerInfo: peerInfo, handshake: handshake}
+}
+
+func (n *network) RegisterListener(l PacketListener) {
+	n.listener = l
+}
+
+// SendHandshake dials the peer, exchanges the BEP 3 handshake and, once
+// that succeeds, starts the background loop that dispatches every
+// incoming Packet to the registered listener.
+func (n *network) SendHandshake() error {
+	addr := net.JoinHostPort(n.peerInfo.IP, strconv.Itoa(n.peerInfo.Port))
+	conn, err := net.DialTimeout("tcp", addr, handshakeTimeout)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(encodeHandshake(n.handshake)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := readHandshake(conn, n.handshake.infoHash); err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.mu.Lock()
+	n.conn = conn
+	n.mu.Unlock()
+
+	go n.readLoop(conn)
+	return nil
+}
+
+func (n *network) Send(p Packet) {
+	n.mu.Lock()
+	conn := n.conn
+	n.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	conn.Write(encodeWire(p))
+}
+
+func (n *network) readLoop(conn net.Conn) {
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		if n.listener != nil {
+			n.listener.NewPacket(p)
+		}
+	}
+}
+
+func encodeHandshake(h Handshake) []byte {
+	buf := make([]byte, 0, 49+len(pstr))
+	buf = append(buf, byte(len(pstr)))
+	buf = append(buf, pstr...)
+	buf = append(buf, make([]byte, 8)...) // reserved
+	buf = append(buf, h.infoHash[:]...)
+	buf = append(buf, h.peerID[:]...)
+	return buf
+}
+
+// readHandshake reads the peer's handshake reply and checks its info
+// hash matches wantInfoHash -- the one thing BEP 3 says a client must
+// verify before trusting the connection at all.
+func readHandshake(conn net.Conn, wantInfoHash [20]byte) error {
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var pstrlen [1]byte
+	if _, err := io.ReadFull(conn, pstrlen[:]); err != nil {
+		return err
+	}
+
+	rest := make([]byte, int(pstrlen[0])+48)
+	if _, err := io.ReadFull(conn, rest); err != nil {
+		return err
+	}
+
+	infoHash := rest[int(pstrlen[0])+8 : int(pstrlen[0])+28]
+	if !bytes.Equal(infoHash, wantInfoHash[:]) {
+		return errors.New("peer: handshake info hash mismatch")
+	}
+	return nil
+}
+
+// encodeWire prepends the 4-byte length prefix (and, for every id but
+// keepAlaive, the id byte) BEP 3 wraps every message in.
+func encodeWire(p Packet) []byte {
+	if p.ID() == keepAlaive {
+		return []byte{0, 0, 0, 0}
+	}
+
+	payload := p.Payload()
+	out := make([]byte, 4+1+len(payload))
+	binary.BigEndian.PutUint32(out[0:4], uint32(1+len(payload)))
+	out[4] = byte(p.ID())
+	copy(out[5:], payload)
+	return out
+}
+
+// readPacket reads one length-prefixed message off conn. An id outside
+// the set this client understands comes back as unknown rather than an
+// error, so an unrecognized (or not-yet-negotiated) message type doesn't
+// tear down the connection.
+func readPacket(conn net.Conn) (Packet, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lenBuf[:])
+	if length == 0 {
+		return newPacket(keepAlaive, nil), nil
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+
+	id := int(body[0])
+	switch id {
+	case choke, unchoke, interested, notInterested, have, bitfield, request, piece, cancel, port, extended:
+		return newPacket(id, body[1:]), nil
+	default:
+		return newPacket(unknown, body[1:]), nil
+	}
+}
@@ -0,0 +1,70 @@
+package peer
+
+import "encoding/binary"
+
+// BEP 3 message ids. keepAlaive and unknown aren't real wire ids -- a
+// keep-alive is the zero-length message that carries no id byte at all,
+// and unknown covers any id this client doesn't recognize -- so both
+// need values outside the 0-9 (and extension.go's 20) range real ids
+// occupy.
+const (
+	keepAlaive    = -1
+	choke         = 0
+	unchoke       = 1
+	interested    = 2
+	notInterested = 3
+	have          = 4
+	bitfield      = 5
+	request       = 6
+	piece         = 7
+	cancel        = 8
+	port          = 9
+	unknown       = -2
+)
+
+// Packet is one message of the wire protocol (BEP 3): an id and,
+// for every id but keepAlaive, a payload.
+type Packet interface {
+	ID() int
+	Payload() []byte
+}
+
+type packet struct {
+	id      int
+	payload []byte
+}
+
+func (p *packet) ID() int         { return p.id }
+func (p *packet) Payload() []byte { return p.payload }
+
+func newPacket(id int, payload []byte) Packet {
+	return &packet{id: id, payload: payload}
+}
+
+func encodeInterested() Packet {
+	return newPacket(interested, nil)
+}
+
+func encodePieceRequest(index, offset, length uint32) Packet {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	binary.BigEndian.PutUint32(payload[4:8], offset)
+	binary.BigEndian.PutUint32(payload[8:12], length)
+	return newPacket(request, payload)
+}
+
+func decodeRequest(payload []byte) (index, offset, length uint32) {
+	if len(payload) < 12 {
+		return 0, 0, 0
+	}
+	return binary.BigEndian.Uint32(payload[0:4]),
+		binary.BigEndian.Uint32(payload[4:8]),
+		binary.BigEndian.Uint32(payload[8:12])
+}
+
+func decodePiece(payload []byte) (index, offset uint32, block []byte) {
+	if len(payload) < 8 {
+		return 0, 0, nil
+	}
+	return binary.BigEndian.Uint32(payload[0:4]), binary.BigEndian.Uint32(payload[4:8]), payload[8:]
+}
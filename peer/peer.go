@@ -1,10 +1,12 @@
 package peer
 
 import (
+	"encoding/binary"
 	"fmt"
 	"strconv"
 
 	log "github.com/bkolad/gTorrent/logger"
+	"github.com/bkolad/gTorrent/storage"
 	"github.com/bkolad/gTorrent/torrent"
 )
 
@@ -34,11 +36,26 @@ type simplePeer struct {
 	chocked    bool
 	bitfield   []byte
 	interested bool
+
+	peerExtensions map[string]byte   // BEP 10: extension name -> message id, as advertised by the remote peer
+	metadata       *metadataTransfer // non-nil while fetching the info dict over ut_metadata (BEP 9)
+
+	torrentInfo    *torrent.Info
+	storageBackend storage.Storage
+	pieceBuffers   map[uint32][]byte // piece index -> bytes assembled so far
+	pieceReceived  map[uint32]int    // piece index -> bytes received so far
+
+	picker *PiecePicker
 }
 
 func newPeer(messages chan MSG, peerInfo torrent.PeerInfo, handshake Handshake) Peer {
 	net := NewNetwork(peerInfo, handshake)
-	peer := &simplePeer{msgs: messages, net: net}
+	peer := &simplePeer{
+		msgs:          messages,
+		net:           net,
+		pieceBuffers:  map[uint32][]byte{},
+		pieceReceived: map[uint32]int{},
+	}
 	net.RegisterListener(peer)
 	return peer
 }
@@ -48,6 +65,11 @@ func (p *simplePeer) start() {
 	if err != nil {
 		fmt.Println("Err" + err.Error())
 		p.msgs <- handshakeError{}
+		return
+	}
+
+	if p.metadata != nil {
+		p.sendExtendedHandshake()
 	}
 }
 
@@ -63,8 +85,28 @@ func (p *simplePeer) onChoke() {
 func (p *simplePeer) onUnchoke() {
 	log.Debug("Unchoked")
 	p.chocked = false
-	packet := encodePieceRequest(0, 0, 16384)
-	p.send(packet)
+	p.requestNext()
+}
+
+// requestNext asks the shared PiecePicker for the next chunk to request
+// and, if there is one, sends it.
+func (p *simplePeer) requestNext() {
+	if p.picker == nil {
+		return
+	}
+
+	index, offset, length, ok := p.picker.Next(p.bitfield, p)
+	if !ok {
+		return
+	}
+	p.send(encodePieceRequest(uint32(index), uint32(offset), uint32(length)))
+}
+
+// CancelRequest implements Requester so the shared PiecePicker can cancel
+// a duplicated endgame request once another peer delivers the chunk
+// first.
+func (p *simplePeer) CancelRequest(piece, offset, length uint32) {
+	p.send(encodeCancel(piece, offset, length))
 }
 
 func (p *simplePeer) onInterested() {
@@ -77,12 +119,25 @@ func (p *simplePeer) onNotInterested() {
 
 func (p *simplePeer) onHave(payload []byte) {
 	log.Debug("have")
+
+	if len(payload) >= 4 {
+		index := int(binary.BigEndian.Uint32(payload))
+		p.bitfield = setBit(p.bitfield, index)
+		if p.picker != nil {
+			p.picker.OnHave(index)
+		}
+	}
+
 	packet := encodeInterested()
 	p.send(packet)
 }
 
 func (p *simplePeer) onBitfield(bitfield []byte) {
 	p.bitfield = bitfield
+	if p.picker != nil {
+		p.picker.OnBitfield(bitfield)
+	}
+
 	packet := encodeInterested()
 	p.send(packet)
 }
@@ -93,6 +148,48 @@ func (p *simplePeer) onRequest(piece, offset, size uint32) {
 
 func (p *simplePeer) onPiece(piece, offset uint32, payload []byte) {
 	log.Debug("Received piece " + strconv.Itoa(int(piece)) + "  " + strconv.Itoa(int(offset)) + " " + strconv.Itoa(len(payload)))
+
+	if p.storageBackend == nil || p.torrentInfo == nil {
+		return
+	}
+
+	if _, err := p.storageBackend.Piece(int(piece)).WriteAt(payload, int64(offset)); err != nil {
+		log.Debug("failed writing piece " + strconv.Itoa(int(piece)) + ": " + err.Error())
+		return
+	}
+
+	if p.picker != nil {
+		p.picker.Confirm(int(piece), int(offset), p)
+	}
+
+	buf := p.pieceBuffers[piece]
+	if buf == nil {
+		buf = make([]byte, expectedPieceSize(p.torrentInfo, int(piece)))
+		p.pieceBuffers[piece] = buf
+	}
+	copy(buf[offset:], payload)
+	p.pieceReceived[piece] += len(payload)
+
+	if p.pieceReceived[piece] >= len(buf) {
+		delete(p.pieceBuffers, piece)
+		delete(p.pieceReceived, piece)
+
+		if !verifyPiece(p.torrentInfo, int(piece), buf) {
+			log.Debug("piece " + strconv.Itoa(int(piece)) + " failed hash check, re-requesting")
+			if p.picker != nil {
+				p.picker.MarkFailed(int(piece))
+			}
+		} else {
+			if err := p.storageBackend.Piece(int(piece)).MarkComplete(); err != nil {
+				log.Debug("failed marking piece " + strconv.Itoa(int(piece)) + " complete: " + err.Error())
+			}
+			if p.picker != nil {
+				p.picker.MarkComplete(int(piece))
+			}
+		}
+	}
+
+	p.requestNext()
 }
 
 func (p *simplePeer) onCancel() {
@@ -135,6 +232,8 @@ func (p *simplePeer) NewPacket(packet Packet) {
 		p.onCancel()
 	case port:
 		p.onPort()
+	case extended:
+		p.onExtended(packet.Payload())
 	case unknown:
 		p.onUnknown()
 	}
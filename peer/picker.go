@@ -0,0 +1,298 @@
+package peer
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// PickerMode selects the strategy PiecePicker uses to choose among
+// equal-priority pieces.
+type PickerMode int
+
+const (
+	// Rarest requests the piece held by the fewest connected peers first,
+	// spreading rare pieces through the swarm as early as possible.
+	Rarest PickerMode = iota
+	// Sequential requests the lowest-index missing piece first, which is
+	// what a caller streaming the torrent as it downloads wants.
+	Sequential
+)
+
+// Priority raises how eagerly PiecePicker hands out a piece, for callers
+// (e.g. a streaming Reader) that care about some region of the torrent
+// more than the rest.
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityNormal
+	PriorityNext
+	PriorityNow
+)
+
+// endgameThreshold is how many pieces may remain before PiecePicker starts
+// duplicating outstanding requests across peers.
+const endgameThreshold = 10
+
+// Requester is implemented by a connected peer so PiecePicker can cancel
+// a duplicated endgame request once another peer delivers the same chunk
+// first.
+type Requester interface {
+	CancelRequest(piece, offset, length uint32)
+}
+
+type pieceState struct {
+	have      bool
+	priority  Priority
+	peerCount int // number of connected peers known to have this piece
+	pieceLen  int
+	pending   []int               // chunk offsets not yet requested
+	inFlight  map[int][]Requester // offset -> peers currently waiting on it (len > 1 only in endgame)
+}
+
+// PiecePicker tracks which pieces are missing, which peers have which
+// pieces, and decides what to request next. It's owned by the torrent
+// session and shared by every connected peer.
+type PiecePicker struct {
+	mu     sync.Mutex
+	mode   PickerMode
+	pieces []pieceState
+	chunk  int
+}
+
+// NewPiecePicker returns a PiecePicker for info's pieces using mode as the
+// selection strategy. Every piece starts at PriorityNormal.
+func NewPiecePicker(info *torrent.Info, mode PickerMode) *PiecePicker {
+	lastSize, numPieces := info.CalculateLastPieceSize()
+
+	pieces := make([]pieceState, numPieces)
+	for i := range pieces {
+		pieceLen := info.PieceSize
+		if i == numPieces-1 {
+			pieceLen = lastSize
+		}
+		pieces[i] = pieceState{
+			priority: PriorityNormal,
+			pieceLen: pieceLen,
+			pending:  offsetsFor(pieceLen, info.ChunkSize),
+			inFlight: map[int][]Requester{},
+		}
+	}
+
+	return &PiecePicker{mode: mode, pieces: pieces, chunk: info.ChunkSize}
+}
+
+// SetPriority raises or lowers how eagerly piece index is requested, e.g.
+// so a streaming Reader can pull the piece it's blocked on ahead of
+// everything else.
+func (pp *PiecePicker) SetPriority(index int, priority Priority) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if index < 0 || index >= len(pp.pieces) {
+		return
+	}
+	pp.pieces[index].priority = priority
+}
+
+// OnBitfield records that a peer reported having the pieces set in
+// bitfield.
+func (pp *PiecePicker) OnBitfield(bitfield []byte) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	for i := range pp.pieces {
+		if hasBit(bitfield, i) {
+			pp.pieces[i].peerCount++
+		}
+	}
+}
+
+// OnHave records that a peer reported newly having a single piece.
+func (pp *PiecePicker) OnHave(index int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if index < 0 || index >= len(pp.pieces) {
+		return
+	}
+	pp.pieces[index].peerCount++
+}
+
+// Next picks the next (piece, offset, length) chunk to request on behalf
+// of requester, whose remote bitfield is peerHas. ok is false if there's
+// nothing left to usefully ask that peer for right now.
+//
+// Outside endgame, each chunk is only ever outstanding to one peer at a
+// time, picked in priority order and then by mode (Rarest or Sequential).
+// Once endgameThreshold or fewer pieces remain, already-outstanding
+// chunks become eligible again so they get duplicated across peers;
+// Confirm cancels the losing duplicates once one of them arrives.
+func (pp *PiecePicker) Next(peerHas []byte, requester Requester) (index, offset, length int, ok bool) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	if best := pp.bestWithPending(peerHas); best != -1 {
+		p := &pp.pieces[best]
+		off := p.pending[0]
+		p.pending = p.pending[1:]
+		p.inFlight[off] = append(p.inFlight[off], requester)
+		return best, off, pp.chunkLength(p, off), true
+	}
+
+	if pp.remainingLocked() > endgameThreshold {
+		return 0, 0, 0, false
+	}
+
+	if best := pp.bestInFlight(peerHas); best != -1 {
+		p := &pp.pieces[best]
+		for off := range p.inFlight {
+			p.inFlight[off] = append(p.inFlight[off], requester)
+			return best, off, pp.chunkLength(p, off), true
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+func (pp *PiecePicker) bestWithPending(peerHas []byte) int {
+	best := -1
+	for i := range pp.pieces {
+		p := &pp.pieces[i]
+		if p.have || len(p.pending) == 0 || !hasBit(peerHas, i) {
+			continue
+		}
+		if best == -1 || pp.better(i, best) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (pp *PiecePicker) bestInFlight(peerHas []byte) int {
+	best := -1
+	for i := range pp.pieces {
+		p := &pp.pieces[i]
+		if p.have || len(p.inFlight) == 0 || !hasBit(peerHas, i) {
+			continue
+		}
+		if best == -1 || pp.better(i, best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Confirm records that offset within piece index arrived from from. Any
+// other peer still waiting on that exact chunk (only possible in
+// endgame) is told to cancel its now-redundant request.
+func (pp *PiecePicker) Confirm(index, offset int, from Requester) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if index < 0 || index >= len(pp.pieces) {
+		return
+	}
+
+	p := &pp.pieces[index]
+	for _, r := range p.inFlight[offset] {
+		if r != from {
+			r.CancelRequest(uint32(index), uint32(offset), uint32(pp.chunkLength(p, offset)))
+		}
+	}
+	delete(p.inFlight, offset)
+}
+
+// MarkComplete marks a piece as fully downloaded and verified, so it's
+// never requested again.
+func (pp *PiecePicker) MarkComplete(index int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if index < 0 || index >= len(pp.pieces) {
+		return
+	}
+	p := &pp.pieces[index]
+	p.have = true
+	p.pending = nil
+	p.inFlight = map[int][]Requester{}
+}
+
+// MarkFailed re-queues every chunk of a piece that failed its hash check.
+func (pp *PiecePicker) MarkFailed(index int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if index < 0 || index >= len(pp.pieces) {
+		return
+	}
+	p := &pp.pieces[index]
+	p.pending = offsetsFor(p.pieceLen, pp.chunk)
+	p.inFlight = map[int][]Requester{}
+}
+
+func (pp *PiecePicker) remainingLocked() int {
+	n := 0
+	for _, p := range pp.pieces {
+		if !p.have {
+			n++
+		}
+	}
+	return n
+}
+
+// better reports whether piece a should be requested ahead of piece b:
+// higher priority always wins, then the picker's mode breaks ties.
+func (pp *PiecePicker) better(a, b int) bool {
+	if pp.pieces[a].priority != pp.pieces[b].priority {
+		return pp.pieces[a].priority > pp.pieces[b].priority
+	}
+
+	if pp.mode == Sequential {
+		return a < b
+	}
+
+	if pp.pieces[a].peerCount != pp.pieces[b].peerCount {
+		return pp.pieces[a].peerCount < pp.pieces[b].peerCount
+	}
+	return rand.Intn(2) == 0
+}
+
+func (pp *PiecePicker) chunkLength(p *pieceState, offset int) int {
+	if remaining := p.pieceLen - offset; remaining < pp.chunk {
+		return remaining
+	}
+	return pp.chunk
+}
+
+func offsetsFor(pieceLen, chunk int) []int {
+	var offsets []int
+	for off := 0; off < pieceLen; off += chunk {
+		offsets = append(offsets, off)
+	}
+	return offsets
+}
+
+func hasBit(bitfield []byte, index int) bool {
+	byteIndex := index / 8
+	if byteIndex >= len(bitfield) {
+		return false
+	}
+	return bitfield[byteIndex]&(1<<uint(7-index%8)) != 0
+}
+
+func setBit(bitfield []byte, index int) []byte {
+	byteIndex := index / 8
+	if byteIndex >= len(bitfield) {
+		grown := make([]byte, byteIndex+1)
+		copy(grown, bitfield)
+		bitfield = grown
+	}
+	bitfield[byteIndex] |= 1 << uint(7-index%8)
+	return bitfield
+}
+
+func encodeCancel(piece, offset, length uint32) Packet {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:4], piece)
+	binary.BigEndian.PutUint32(payload[4:8], offset)
+	binary.BigEndian.PutUint32(payload[8:12], length)
+	return newPacket(cancel, payload)
+}
@@ -0,0 +1,161 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/bkolad/gTorrent/peer"
+)
+
+// Reader streams one file out of an in-progress torrent, blocking each
+// read on the pieces it needs and raising their picker priority so they
+// arrive ahead of the rest of the swarm's normal download order -- enough
+// to let something like http.ServeContent serve a file that hasn't
+// finished downloading yet.
+type Reader struct {
+	session *Session
+	base    int64 // offset of this file within the torrent
+	length  int64
+
+	mu           sync.Mutex
+	pos          int64
+	activePieces []int
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+var _ io.ReadSeeker = (*Reader)(nil)
+var _ io.ReaderAt = (*Reader)(nil)
+
+// Read implements io.Reader, advancing the Reader's position the way
+// os.File does.
+func (r *Reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	pos := r.pos
+	r.mu.Unlock()
+
+	n, err := r.ReadAt(p, pos)
+
+	r.mu.Lock()
+	r.pos += int64(n)
+	r.mu.Unlock()
+	return n, err
+}
+
+// Seek implements io.Seeker. Seeking anywhere drops the priority this
+// Reader raised for its previous position -- the pieces it was about to
+// need are no longer the ones it's about to need.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = r.pos + offset
+	case io.SeekEnd:
+		newPos = r.length + offset
+	default:
+		return 0, errors.New("session: invalid whence")
+	}
+	if newPos < 0 {
+		return 0, errors.New("session: negative position")
+	}
+
+	r.resetPrioritiesLocked()
+	r.pos = newPos
+	return newPos, nil
+}
+
+// Close drops any priority this Reader raised and stops it from blocking
+// any future ReadAt calls on an outstanding wait. It's safe to call more
+// than once.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	r.resetPrioritiesLocked()
+	r.mu.Unlock()
+
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+// ReadAt implements io.ReaderAt. It computes which piece(s) off falls
+// into, raises that piece to PriorityNow (and the next readahead/PieceSize
+// pieces to PriorityNext) before blocking until the storage backend has
+// verified it, then copies the bytes out.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("session: negative offset")
+	}
+	if off >= r.length {
+		return 0, io.EOF
+	}
+
+	want := p
+	atEOF := false
+	if avail := r.length - off; int64(len(want)) > avail {
+		want = want[:avail]
+		atEOF = true
+	}
+
+	pieceSize := int64(r.session.info.PieceSize)
+	total := 0
+	for total < len(want) {
+		abs := r.base + off + int64(total)
+		pieceIndex := int(abs / pieceSize)
+		pieceOffset := int(abs % pieceSize)
+
+		r.raisePriorities(pieceIndex)
+		if err := r.session.waitForPiece(pieceIndex, r.closed); err != nil {
+			return total, err
+		}
+
+		chunk := want[total:]
+		if max := int(pieceSize) - pieceOffset; len(chunk) > max {
+			chunk = chunk[:max]
+		}
+
+		n, err := r.session.backend.Piece(pieceIndex).ReadAt(chunk, int64(pieceOffset))
+		total += n
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+	}
+
+	if atEOF {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// raisePriorities drops whatever priority this Reader previously raised
+// and raises pieceIndex to PriorityNow and the following readahead
+// pieces to PriorityNext.
+func (r *Reader) raisePriorities(pieceIndex int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resetPrioritiesLocked()
+
+	r.session.picker.SetPriority(pieceIndex, peer.PriorityNow)
+	r.activePieces = append(r.activePieces, pieceIndex)
+
+	readaheadPieces := r.session.readahead / int(r.session.info.PieceSize)
+	for i := 1; i <= readaheadPieces; i++ {
+		idx := pieceIndex + i
+		r.session.picker.SetPriority(idx, peer.PriorityNext)
+		r.activePieces = append(r.activePieces, idx)
+	}
+}
+
+// resetPrioritiesLocked drops every piece this Reader raised back to
+// PriorityNormal. Callers must hold r.mu.
+func (r *Reader) resetPrioritiesLocked() {
+	for _, idx := range r.activePieces {
+		r.session.picker.SetPriority(idx, peer.PriorityNormal)
+	}
+	r.activePieces = nil
+}
@@ -0,0 +1,101 @@
+// Package session ties a torrent's metadata, storage backend and piece
+// picker together into the one long-lived object every connected peer
+// and every streaming Reader shares, filling the orchestration role
+// main.go would otherwise have to take on itself.
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bkolad/gTorrent/peer"
+	"github.com/bkolad/gTorrent/storage"
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// defaultReadahead is how far past the current read position NewReader
+// keeps pieces at PriorityNext, in bytes.
+const defaultReadahead = 5 * 1024 * 1024
+
+// pieceWaitPoll is how often a Reader checks whether the piece it's
+// blocked on has been verified -- there's no completion event to wait on,
+// so it polls.
+const pieceWaitPoll = 100 * time.Millisecond
+
+// Session is a single torrent download in progress: its metadata, where
+// its pieces are stored, and the picker deciding what to fetch next.
+type Session struct {
+	info      *torrent.Info
+	backend   storage.Storage
+	picker    *peer.PiecePicker
+	readahead int
+}
+
+// NewSession returns a Session for info, backed by backend and driven by
+// picker, the same PiecePicker shared by every connected peer.
+func NewSession(info *torrent.Info, backend storage.Storage, picker *peer.PiecePicker) *Session {
+	return &Session{info: info, backend: backend, picker: picker, readahead: defaultReadahead}
+}
+
+// SetReadahead overrides the default 5 MiB readahead window used by
+// Readers created from this point on.
+func (s *Session) SetReadahead(bytes int) {
+	s.readahead = bytes
+}
+
+// NewReader returns a Reader streaming the fileIndex'th file out of the
+// torrent (in the order torrent.Info.Files reports them, or the single
+// file described by info.Name/info.Length for a single-file torrent).
+func (s *Session) NewReader(fileIndex int) (*Reader, error) {
+	base, length, err := s.fileBounds(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		session: s,
+		base:    base,
+		length:  length,
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+func (s *Session) fileBounds(fileIndex int) (base, length int64, err error) {
+	files := s.info.Files()
+	if files == nil {
+		if fileIndex != 0 {
+			return 0, 0, fmt.Errorf("session: file index %d out of range", fileIndex)
+		}
+		return 0, int64(s.info.Length), nil
+	}
+
+	if fileIndex < 0 || fileIndex >= len(files) {
+		return 0, 0, fmt.Errorf("session: file index %d out of range", fileIndex)
+	}
+	for i := 0; i < fileIndex; i++ {
+		base += int64(files[i].Length)
+	}
+	return base, int64(files[fileIndex].Length), nil
+}
+
+// waitForPiece blocks until index is verified complete in the storage
+// backend, or stop is closed.
+func (s *Session) waitForPiece(index int, stop <-chan struct{}) error {
+	piece := s.backend.Piece(index)
+	if c := piece.Completion(); c.Ok && c.Complete {
+		return nil
+	}
+
+	ticker := time.NewTicker(pieceWaitPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if c := piece.Completion(); c.Ok && c.Complete {
+				return nil
+			}
+		case <-stop:
+			return fmt.Errorf("session: reader closed while waiting for piece %d", index)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "github.com/bkolad/gTorrent/torrent"
+
+type fileStorage struct {
+	info       *torrent.Info
+	segments   []segment
+	completion *completionTracker
+}
+
+// NewFile returns a Storage that lays the torrent out on disk under root.
+func NewFile(root string, info *torrent.Info) (Storage, error) {
+	handles, files, err := layoutFiles(root, info)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, len(files))
+	var offset int64
+	for i, f := range files {
+		segments[i] = segment{handles[i], handles[i], offset, int64(f.Length)}
+		offset += int64(f.Length)
+	}
+
+	_, numPieces := info.CalculateLastPieceSize()
+	return &fileStorage{info, segments, newCompletionTracker(numPieces)}, nil
+}
+
+func (s *fileStorage) Piece(index int) PieceStore {
+	return &diskPiece{
+		segments: s.segments,
+		offset:   int64(index) * int64(s.info.PieceSize),
+		index:    index,
+		tracker:  s.completion,
+	}
+}
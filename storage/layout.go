@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// segment is one underlying file's byte range within the flattened
+// (concatenated) view of a torrent's files.
+type segment struct {
+	r     io.ReaderAt
+	w     io.WriterAt
+	start int64
+	size  int64
+}
+
+// layoutFiles creates (and truncates to size) every underlying file for
+// info under root, exactly as a reference client would: a single file
+// named info.Name for single-file torrents, or a directory named
+// info.Name containing info.Files() for multi-file ones. It returns the
+// open *os.File handles alongside the file list so callers can wrap them
+// however they need to (plain, mmap'd, ...).
+func layoutFiles(root string, info *torrent.Info) ([]*os.File, []torrent.File, error) {
+	files := info.Files()
+	if files == nil {
+		files = []torrent.File{{Length: info.Length, Path: []string{info.Name}}}
+	} else {
+		root = filepath.Join(root, info.Name)
+	}
+
+	handles := make([]*os.File, len(files))
+	for i, f := range files {
+		path := filepath.Join(append([]string{root}, f.Path...)...)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, nil, err
+		}
+
+		fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fh.Truncate(int64(f.Length)); err != nil {
+			return nil, nil, err
+		}
+		handles[i] = fh
+	}
+
+	return handles, files, nil
+}
+
+func segmentAt(segments []segment, pos int64) *segment {
+	for i := range segments {
+		if pos >= segments[i].start && pos < segments[i].start+segments[i].size {
+			return &segments[i]
+		}
+	}
+	return nil
+}
+
+// readAt and writeAt split a read/write that may span several underlying
+// segments into per-segment calls at the flattened-torrent offset pos.
+func readAt(segments []segment, b []byte, pos int64) (int, error) {
+	var n int
+	for len(b) > 0 {
+		seg := segmentAt(segments, pos)
+		if seg == nil {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		segOff := pos - seg.start
+		chunk := b
+		if remaining := seg.size - segOff; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		m, err := seg.r.ReadAt(chunk, segOff)
+		n += m
+		pos += int64(m)
+		b = b[m:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func writeAt(segments []segment, b []byte, pos int64) (int, error) {
+	var n int
+	for len(b) > 0 {
+		seg := segmentAt(segments, pos)
+		if seg == nil {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		segOff := pos - seg.start
+		chunk := b
+		if remaining := seg.size - segOff; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		m, err := seg.w.WriteAt(chunk, segOff)
+		n += m
+		pos += int64(m)
+		b = b[m:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// completionTracker records which piece indices have been marked
+// complete for a Storage. fileStorage and mmapStorage hand out a new
+// diskPiece on every Piece(index) call, so the flag can't live on
+// diskPiece itself -- it has to live somewhere shared that outlives any
+// one call, the way memoryStorage's pre-allocated []*memoryPiece already
+// does implicitly.
+type completionTracker struct {
+	mu       sync.Mutex
+	complete []bool
+}
+
+func newCompletionTracker(numPieces int) *completionTracker {
+	return &completionTracker{complete: make([]bool, numPieces)}
+}
+
+func (t *completionTracker) markComplete(index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.complete[index] = true
+}
+
+func (t *completionTracker) completion(index int) Completion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Completion{Complete: t.complete[index], Ok: true}
+}
+
+// diskPiece is the PieceStore shared by the file and mmap backends: both
+// just split reads/writes across a segment list, plugging in different
+// io.ReaderAt/io.WriterAt implementations for the read side. Completion
+// is delegated to the storage's shared completionTracker, keyed by index,
+// so it survives past the single Piece(index) call that created this
+// diskPiece.
+type diskPiece struct {
+	segments []segment
+	offset   int64
+	index    int
+	tracker  *completionTracker
+}
+
+func (p *diskPiece) ReadAt(b []byte, off int64) (int, error) {
+	return readAt(p.segments, b, p.offset+off)
+}
+
+func (p *diskPiece) WriteAt(b []byte, off int64) (int, error) {
+	return writeAt(p.segments, b, p.offset+off)
+}
+
+func (p *diskPiece) MarkComplete() error {
+	p.tracker.markComplete(p.index)
+	return nil
+}
+
+func (p *diskPiece) Completion() Completion {
+	return p.tracker.completion(p.index)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+type memoryStorage struct {
+	pieces []*memoryPiece
+}
+
+// NewMemory returns a Storage that keeps every piece in RAM rather than
+// on disk. It's mainly useful for tests and for torrents small enough to
+// fit entirely in memory; nothing is persisted across restarts.
+func NewMemory(info *torrent.Info) Storage {
+	_, numPieces := info.CalculateLastPieceSize()
+	pieces := make([]*memoryPiece, numPieces)
+	for i := range pieces {
+		pieces[i] = &memoryPiece{}
+	}
+	return &memoryStorage{pieces}
+}
+
+func (s *memoryStorage) Piece(index int) PieceStore {
+	return s.pieces[index]
+}
+
+type memoryPiece struct {
+	mu       sync.Mutex
+	data     []byte
+	complete bool
+}
+
+func (p *memoryPiece) ReadAt(b []byte, off int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if off >= int64(len(p.data)) {
+		return 0, errors.New("read past end of piece")
+	}
+	n := copy(b, p.data[off:])
+	if n < len(b) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func (p *memoryPiece) WriteAt(b []byte, off int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if end := off + int64(len(b)); int64(len(p.data)) < end {
+		grown := make([]byte, end)
+		copy(grown, p.data)
+		p.data = grown
+	}
+	return copy(p.data[off:], b), nil
+}
+
+func (p *memoryPiece) MarkComplete() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.complete = true
+	return nil
+}
+
+func (p *memoryPiece) Completion() Completion {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Completion{Complete: p.complete, Ok: true}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"golang.org/x/exp/mmap"
+
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+type mmapStorage struct {
+	info       *torrent.Info
+	segments   []segment
+	completion *completionTracker
+}
+
+// NewMmap returns a Storage like NewFile, but serves reads through a
+// memory-mapped view of each underlying file (golang.org/x/exp/mmap) for
+// zero-copy reads. Writes still go through the regular file handle,
+// since that package only maps files read-only.
+func NewMmap(root string, info *torrent.Info) (Storage, error) {
+	handles, files, err := layoutFiles(root, info)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, len(files))
+	var offset int64
+	for i, f := range files {
+		ra, err := mmap.Open(handles[i].Name())
+		if err != nil {
+			return nil, err
+		}
+
+		segments[i] = segment{ra, handles[i], offset, int64(f.Length)}
+		offset += int64(f.Length)
+	}
+
+	_, numPieces := info.CalculateLastPieceSize()
+	return &mmapStorage{info, segments, newCompletionTracker(numPieces)}, nil
+}
+
+func (s *mmapStorage) Piece(index int) PieceStore {
+	return &diskPiece{
+		segments: s.segments,
+		offset:   int64(index) * int64(s.info.PieceSize),
+		index:    index,
+		tracker:  s.completion,
+	}
+}
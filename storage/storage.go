@@ -0,0 +1,32 @@
+// Package storage provides pluggable backends for where a torrent's
+// pieces actually live on the local machine, mirroring the layered
+// approach used by mature BitTorrent clients: a Storage lays a torrent
+// out once and hands back a PieceStore per piece for reading/writing
+// chunks and tracking completion.
+package storage
+
+import "io"
+
+// Storage lays out a torrent's pieces on some backing medium and hands
+// out a PieceStore for each one.
+type Storage interface {
+	Piece(index int) PieceStore
+}
+
+// PieceStore is the read/write surface for a single piece.
+type PieceStore interface {
+	io.ReaderAt
+	io.WriterAt
+	MarkComplete() error
+	Completion() Completion
+}
+
+// Completion describes what a PieceStore knows about its own piece.
+// Ok is false when the backend can't tell, in which case Complete should
+// be ignored and the piece re-verified. The backends in this package keep
+// completion in memory for the life of the Storage (nothing is persisted)
+// and always report Ok.
+type Completion struct {
+	Complete bool
+	Ok       bool
+}
@@ -0,0 +1,35 @@
+// Package mmap is a minimal, locally-vendored stand-in for
+// golang.org/x/exp/mmap: just enough of its Open/ReaderAt surface for
+// storage/mmap.go, substituted in via the root go.mod's replace
+// directive because this environment has no network access to fetch
+// the real module. It reads through the regular file handle rather
+// than an actual memory mapping, so it gives up the zero-copy win
+// storage/mmap.go's doc comment advertises, but the io.ReaderAt
+// contract callers depend on is identical.
+package mmap
+
+import "os"
+
+// ReaderAt is a read-only view of a file.
+type ReaderAt struct {
+	f *os.File
+}
+
+// Open opens the file at path for reading.
+func Open(path string) (*ReaderAt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReaderAt{f: f}, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.f.ReadAt(p, off)
+}
+
+// Close closes the underlying file.
+func (r *ReaderAt) Close() error {
+	return r.f.Close()
+}
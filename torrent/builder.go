@@ -0,0 +1,141 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type builderFile struct {
+	Length int      `bencode:"length"`
+	Path   []string `bencode:"path"`
+}
+
+type builderInfo struct {
+	Name        string        `bencode:"name"`
+	PieceLength int           `bencode:"piece length"`
+	Pieces      string        `bencode:"pieces"`
+	Length      int           `bencode:"length,omitempty"`
+	Files       []builderFile `bencode:"files,omitempty"`
+}
+
+type builderTorrent struct {
+	Announce     string      `bencode:"announce"`
+	AnnounceList [][]string  `bencode:"announce-list,omitempty"`
+	Info         builderInfo `bencode:"info"`
+}
+
+// Builder creates a .torrent file from a single file or a directory on
+// disk -- the mirror image of TorrentDecoder.
+type Builder struct {
+	Tracker      string
+	AnnounceList [][]string
+	PieceSize    int
+}
+
+// NewBuilder returns a Builder that announces to tracker and chunks
+// files into pieceSize-sized pieces.
+func NewBuilder(tracker string, pieceSize int) *Builder {
+	return &Builder{Tracker: tracker, PieceSize: pieceSize}
+}
+
+// Build walks path (a single file or a directory) and writes the
+// resulting .torrent file to w.
+func (b *Builder) Build(path string, w io.Writer) error {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	var files []builderFile
+	var length int
+
+	if fi.IsDir() {
+		err = filepath.Walk(root, func(p string, entry os.FileInfo, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, p)
+			files = append(files, builderFile{
+				Length: int(entry.Size()),
+				Path:   strings.Split(rel, string(filepath.Separator)),
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		paths = []string{root}
+		length = int(fi.Size())
+	}
+
+	pieces, err := hashPieces(paths, b.PieceSize)
+	if err != nil {
+		return err
+	}
+
+	t := builderTorrent{
+		Announce:     b.Tracker,
+		AnnounceList: b.AnnounceList,
+		Info: builderInfo{
+			Name:        filepath.Base(root),
+			PieceLength: b.PieceSize,
+			Pieces:      string(pieces),
+			Length:      length,
+			Files:       files,
+		},
+	}
+
+	encoded, err := Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// hashPieces reads paths as one concatenated stream, exactly the way a
+// multi-file torrent's pieces are laid out, and returns the SHA1 of every
+// pieceSize-sized chunk.
+func hashPieces(paths []string, pieceSize int) ([]byte, error) {
+	readers := make([]io.Reader, len(paths))
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+
+	r := io.MultiReader(readers...)
+	buf := make([]byte, pieceSize)
+
+	var pieces []byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces = append(pieces, sum[:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pieces, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
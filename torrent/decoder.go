@@ -29,6 +29,26 @@ type TorrentDecoder interface {
 	Decode() (*Info, error)
 }
 
+// File describes one entry of a multi-file torrent.
+type File struct {
+	Length int
+	Path   []string
+}
+
+// Files returns the torrent's file list for multi-file torrents, in the
+// same order as on the wire. It's nil for single-file torrents, where
+// Name and Length already describe the one file.
+func (info *Info) Files() []File {
+	if info.files == nil {
+		return nil
+	}
+	out := make([]File, len(info.files))
+	for i, f := range info.files {
+		out[i] = File{f.length, f.path}
+	}
+	return out
+}
+
 type torrentDec struct {
 	str string
 }
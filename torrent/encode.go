@@ -0,0 +1,130 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Marshal bencodes v (BEP 3). v may be an int, a string, a []byte, a
+// slice, a map[string]interface{}, or a struct whose fields carry
+// `bencode:"name"` tags -- a field without one is skipped, and
+// `bencode:"name,omitempty"` skips a zero-valued field too. Dict keys
+// (map keys and struct tag names) are written in sorted order, as BEP 3
+// requires.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		return errors.New("bencode: cannot encode a nil value")
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return errors.New("bencode: cannot encode a nil value")
+		}
+		return encodeValue(buf, v.Elem())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(buf, "i%de", v.Int())
+		return nil
+
+	case reflect.String:
+		s := v.String()
+		fmt.Fprintf(buf, "%d:%s", len(s), s)
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := v.Bytes()
+			fmt.Fprintf(buf, "%d:", len(b))
+			buf.Write(b)
+			return nil
+		}
+
+		buf.WriteByte('l')
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+		return nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.New("bencode: map keys must be strings")
+		}
+
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%d:%s", len(k), k)
+			if err := encodeValue(buf, v.MapIndex(reflect.ValueOf(k))); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+		return nil
+
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+
+	default:
+		return fmt.Errorf("bencode: unsupported type %s", v.Kind())
+	}
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	type taggedField struct {
+		name string
+		val  reflect.Value
+	}
+
+	var fields []taggedField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("bencode")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name, omitempty := tag, false
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, omitempty = tag[:idx], tag[idx+1:] == "omitempty"
+		}
+
+		fieldVal := v.Field(i)
+		if omitempty && fieldVal.IsZero() {
+			continue
+		}
+
+		fields = append(fields, taggedField{name, fieldVal})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+
+	buf.WriteByte('d')
+	for _, f := range fields {
+		fmt.Fprintf(buf, "%d:%s", len(f.name), f.name)
+		if err := encodeValue(buf, f.val); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('e')
+	return nil
+}
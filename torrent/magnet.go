@@ -0,0 +1,75 @@
+package torrent
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// MagnetDecoder decodes a magnet URI.
+type MagnetDecoder interface {
+	Decode() (*Info, error)
+}
+
+type magnetDec struct {
+	uri string
+}
+
+// NewMagnetDecoder returns a decoder for magnet URIs (BEP 9), as an
+// alternative to NewTorrentDecoder for callers that only have a
+// "magnet:?xt=urn:btih:..." link rather than a .torrent file. The
+// resulting Info only carries InfoHash, Name and AnnounceList -- the rest
+// of the metadata is unknown until it's fetched from peers over the
+// ut_metadata extension and merged in with Info.CompleteFromMetadata.
+func NewMagnetDecoder(uri string) MagnetDecoder {
+	return &magnetDec{uri}
+}
+
+func (dec *magnetDec) Decode() (*Info, error) {
+	u, err := url.Parse(dec.uri)
+	if err != nil {
+		return nil, errors.New("Malformed magnet URI: " + err.Error())
+	}
+	if u.Scheme != "magnet" {
+		return nil, errors.New("not a magnet URI")
+	}
+
+	query := u.Query()
+
+	xt := query.Get("xt")
+	if !strings.HasPrefix(xt, "urn:btih:") {
+		return nil, errors.New("magnet URI is missing an urn:btih: info hash")
+	}
+
+	infoHash, err := decodeInfoHash(strings.TrimPrefix(xt, "urn:btih:"))
+	if err != nil {
+		return nil, err
+	}
+
+	var announceList [][]string
+	for _, tr := range query["tr"] {
+		announceList = append(announceList, []string{tr})
+	}
+
+	return &Info{
+		Name:         query.Get("dn"),
+		AnnounceList: announceList,
+		InfoHash:     infoHash,
+		ChunkSize:    chunkSize,
+	}, nil
+}
+
+// decodeInfoHash accepts either the 40-character hex or the 32-character
+// base32 encoding of a BitTorrent info hash (BEP 9 allows both).
+func decodeInfoHash(s string) ([]byte, error) {
+	switch len(s) {
+	case 40:
+		return hex.DecodeString(s)
+	case 32:
+		return base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return nil, errors.New("info hash must be 40 hex or 32 base32 characters long")
+	}
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+)
+
+// CompleteFromMetadata fills in the fields of a partial Info obtained from
+// a magnet URI (PieceSize, Length, files, PieceHashes and, if missing,
+// Name) once the full info dictionary has been reassembled from
+// ut_metadata pieces (BEP 9). raw is verified against info.InfoHash before
+// it's parsed, since it came from an untrusted peer.
+func (info *Info) CompleteFromMetadata(raw []byte) error {
+	sum := sha1.Sum(raw)
+	if !bytes.Equal(sum[:], info.InfoHash) {
+		return errors.New("metadata info hash mismatch")
+	}
+
+	p := NewParser(string(raw))
+	ben, err := p.Parse()
+	if err != nil {
+		return err
+	}
+
+	infoDict, ok := ben.(*bDict)
+	if !ok {
+		return wrongTypeError("info", "dictionary")
+	}
+
+	pieceLength, _, err := intValue(infoDict, "piece length")
+	if err != nil {
+		return err
+	}
+
+	length, isSingleFile, err := intValue(infoDict, "length")
+	if isSingleFile && err != nil {
+		return err
+	}
+
+	fs, err := files(infoDict)
+	if err != nil {
+		return err
+	}
+	if fs == nil && !isSingleFile {
+		return errors.New("No files to download in the torrent file")
+	}
+
+	pieces, err := strValue(infoDict, "pieces")
+	if err != nil {
+		return err
+	}
+	pieceHash, err := pieceHashes(pieces)
+	if err != nil {
+		return err
+	}
+
+	if info.Name == "" {
+		if name, err := strValue(infoDict, "name"); err == nil {
+			info.Name = name
+		}
+	}
+
+	info.PieceSize = pieceLength
+	info.Length = length
+	info.files = fs
+	info.PieceHashes = pieceHash
+	return nil
+}
@@ -0,0 +1,172 @@
+package torrent
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Bencode is a parsed bencoded value (BEP 3): an integer, string, list or
+// dictionary. It's the typed counterpart to the internal/bencodevalue
+// package's decode-into-map-and-type-assert approach, structured for the
+// field-by-field validation NewTorrentDecoder and CompleteFromMetadata
+// need.
+type Bencode interface {
+	// String returns the exact bencoded bytes this value was parsed
+	// from, which is what the info dict's SHA1 has to be taken over.
+	String() string
+	// PrettyString returns the value's plain-string form: a bStr's value
+	// or a bInt's decimal digits (lists and dicts return their raw
+	// bencoding). It exists so callers walking a list of strings (an
+	// announce-list tier, a file path) don't have to type-assert each
+	// element themselves.
+	PrettyString() string
+}
+
+type bInt struct {
+	value int
+	raw   string
+}
+
+func (b *bInt) String() string       { return b.raw }
+func (b *bInt) PrettyString() string { return strconv.Itoa(b.value) }
+
+type bStr struct {
+	value string
+	raw   string
+}
+
+func (b *bStr) String() string       { return b.raw }
+func (b *bStr) PrettyString() string { return b.value }
+
+type bList struct {
+	value []Bencode
+	raw   string
+}
+
+func (b *bList) String() string       { return b.raw }
+func (b *bList) PrettyString() string { return b.raw }
+
+type bDict struct {
+	value map[string]Bencode
+	raw   string
+}
+
+func (b *bDict) String() string       { return b.raw }
+func (b *bDict) PrettyString() string { return b.raw }
+
+func (b *bDict) get(key string) Bencode {
+	return b.value[key]
+}
+
+// Parser parses a bencoded value out of a string, the same spec
+// (BEP 3) as Marshal but keeping each value's raw byte span around so
+// the parsed info dict can be rehashed byte-for-byte.
+type Parser struct {
+	str string
+}
+
+// NewParser returns a Parser over str.
+func NewParser(str string) *Parser {
+	return &Parser{str}
+}
+
+// Parse parses the single bencoded value at the start of the Parser's
+// string -- a .torrent file, and a reassembled ut_metadata info dict,
+// are both exactly one top-level value.
+func (p *Parser) Parse() (Bencode, error) {
+	ben, _, err := parseValue(p.str)
+	return ben, err
+}
+
+func parseValue(s string) (Bencode, string, error) {
+	if len(s) == 0 {
+		return nil, "", errors.New("bencode: unexpected end of input")
+	}
+
+	switch {
+	case s[0] == 'i':
+		return parseInt(s)
+	case s[0] == 'l':
+		return parseList(s)
+	case s[0] == 'd':
+		return parseDict(s)
+	case s[0] >= '0' && s[0] <= '9':
+		return parseStr(s)
+	default:
+		return nil, "", errors.New("bencode: unrecognized token '" + string(s[0]) + "'")
+	}
+}
+
+func parseInt(s string) (Bencode, string, error) {
+	end := strings.IndexByte(s, 'e')
+	if end < 0 {
+		return nil, "", errors.New("bencode: unterminated integer")
+	}
+	n, err := strconv.Atoi(s[1:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return &bInt{value: n, raw: s[:end+1]}, s[end+1:], nil
+}
+
+func parseStr(s string) (Bencode, string, error) {
+	colon := strings.IndexByte(s, ':')
+	if colon < 0 {
+		return nil, "", errors.New("bencode: malformed string length")
+	}
+	n, err := strconv.Atoi(s[:colon])
+	if err != nil {
+		return nil, "", err
+	}
+	start := colon + 1
+	if start+n > len(s) {
+		return nil, "", errors.New("bencode: string runs past end of input")
+	}
+	return &bStr{value: s[start : start+n], raw: s[:start+n]}, s[start+n:], nil
+}
+
+func parseList(s string) (Bencode, string, error) {
+	rest := s[1:]
+	var items []Bencode
+	for len(rest) > 0 && rest[0] != 'e' {
+		item, next, err := parseValue(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+		rest = next
+	}
+	if len(rest) == 0 {
+		return nil, "", errors.New("bencode: unterminated list")
+	}
+	raw := s[:len(s)-len(rest)+1]
+	return &bList{value: items, raw: raw}, rest[1:], nil
+}
+
+func parseDict(s string) (Bencode, string, error) {
+	rest := s[1:]
+	dict := map[string]Bencode{}
+	for len(rest) > 0 && rest[0] != 'e' {
+		key, next, err := parseValue(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		keyStr, ok := key.(*bStr)
+		if !ok {
+			return nil, "", errors.New("bencode: dict key is not a string")
+		}
+
+		val, next2, err := parseValue(next)
+		if err != nil {
+			return nil, "", err
+		}
+		dict[keyStr.value] = val
+		rest = next2
+	}
+	if len(rest) == 0 {
+		return nil, "", errors.New("bencode: unterminated dict")
+	}
+	raw := s[:len(s)-len(rest)+1]
+	return &bDict{value: dict, raw: raw}, rest[1:], nil
+}
@@ -0,0 +1,95 @@
+package torrent
+
+import (
+	"errors"
+	"net"
+
+	"github.com/bkolad/gTorrent/internal/bencodevalue"
+)
+
+// PeerInfo is one peer's address, as handed back by a tracker announce
+// response or a DHT get_peers lookup.
+type PeerInfo struct {
+	IP   string
+	Port int
+}
+
+// TrackerRsp is a tracker's decoded announce response (BEP 3).
+type TrackerRsp struct {
+	Interval  int
+	PeersInfo []*PeerInfo
+}
+
+// TrackerRspDecoder decodes a tracker's bencoded HTTP announce response.
+type TrackerRspDecoder interface {
+	Decode() (*TrackerRsp, error)
+}
+
+type trackerRspDec struct {
+	str string
+}
+
+// NewTrackerRspDecoder returns a decoder for a tracker's announce
+// response body.
+func NewTrackerRspDecoder(str string) TrackerRspDecoder {
+	return &trackerRspDec{str}
+}
+
+func (dec *trackerRspDec) Decode() (*TrackerRsp, error) {
+	dict, _, err := bencodevalue.DecodeDict([]byte(dec.str))
+	if err != nil {
+		return nil, err
+	}
+
+	if reason, ok := dict["failure reason"].(string); ok {
+		return nil, errors.New("tracker failure: " + reason)
+	}
+
+	interval, _ := dict["interval"].(int)
+
+	peers, err := decodeTrackerPeers(dict["peers"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrackerRsp{Interval: interval, PeersInfo: peers}, nil
+}
+
+// decodeTrackerPeers accepts either the compact peer list (a single
+// string of 6-byte IP+port entries, BEP 23) most trackers send, or the
+// older list-of-dictionaries form.
+func decodeTrackerPeers(v interface{}) ([]*PeerInfo, error) {
+	switch peers := v.(type) {
+	case string:
+		if len(peers)%6 != 0 {
+			return nil, errors.New("tracker response: malformed compact peers list")
+		}
+
+		var out []*PeerInfo
+		for i := 0; i+6 <= len(peers); i += 6 {
+			ip := net.IP([]byte(peers[i : i+4]))
+			port := int(peers[i+4])<<8 | int(peers[i+5])
+			out = append(out, &PeerInfo{IP: ip.String(), Port: port})
+		}
+		return out, nil
+
+	case []interface{}:
+		var out []*PeerInfo
+		for _, p := range peers {
+			d, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ip, _ := d["ip"].(string)
+			port, _ := d["port"].(int)
+			out = append(out, &PeerInfo{IP: ip, Port: port})
+		}
+		return out, nil
+
+	case nil:
+		return nil, nil
+
+	default:
+		return nil, errors.New("tracker response: malformed peers field")
+	}
+}
@@ -3,9 +3,11 @@ package tracker
 import (
 	"errors"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	i "github.com/bkolad/gTorrent/init"
 	"github.com/bkolad/gTorrent/torrent"
@@ -15,13 +17,78 @@ type httpTracker struct {
 	url string
 }
 
-//NewTracker creates default tracker
+// NewTracker creates a tracker for info's announce URLs. It honors the
+// announce-list tiers (falling back to the single announce URL when there
+// is no announce-list): trackers within a tier are tried in random order,
+// moving on to the next tier, until one of them returns peers. The
+// implementation used for a given announce URL (http(s) or udp) is chosen
+// by its scheme.
 func NewTracker(info *torrent.Info, initState i.State, conf i.Configuration) (Tracker, error) {
-	url, err := prepareURL(initState, conf.PeerID, conf.Port, info)
+	tiers := info.AnnounceList
+	if len(tiers) == 0 {
+		tiers = [][]string{{info.Announce}}
+	}
+	return &tieredTracker{tiers, info, initState, conf}, nil
+}
+
+type tieredTracker struct {
+	tiers     [][]string
+	info      *torrent.Info
+	initState i.State
+	conf      i.Configuration
+}
+
+func (t *tieredTracker) Peers() ([]*torrent.PeerInfo, error) {
+	var lastErr error
+	for _, tier := range t.tiers {
+		for _, announceURL := range shuffled(tier) {
+			tr, err := newSingleTracker(announceURL, t.info, t.initState, t.conf)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			peers, err := tr.Peers()
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if len(peers) > 0 {
+				return peers, nil
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no tracker in the announce-list returned any peers")
+	}
+	return nil, lastErr
+}
+
+func newSingleTracker(announceURL string, info *torrent.Info, initState i.State, conf i.Configuration) (Tracker, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, errors.New("Malformed URL: " + err.Error())
+	}
+
+	if u.Scheme == "udp" {
+		return newUDPTracker(u.Host, info, initState, conf), nil
+	}
+
+	preparedURL, err := prepareURL(announceURL, initState, conf.PeerID, conf.Port, info)
 	if err != nil {
 		return nil, err
 	}
-	return &httpTracker{url}, nil
+	return &httpTracker{preparedURL}, nil
+}
+
+func shuffled(urls []string) []string {
+	out := make([]string, len(urls))
+	copy(out, urls)
+	rand.Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+	return out
 }
 
 func (t *httpTracker) Peers() ([]*torrent.PeerInfo, error) {
@@ -50,14 +117,18 @@ func (t *httpTracker) Peers() ([]*torrent.PeerInfo, error) {
 	return rsp.PeersInfo, nil
 }
 
-func prepareURL(initState i.State, peerID string, port int, info *torrent.Info) (string, error) {
-	baseURL, err := url.Parse(info.Announce)
+func prepareURL(announceURL string, initState i.State, peerID string, port int, info *torrent.Info) (string, error) {
+	baseURL, err := url.Parse(announceURL)
 	if err != nil {
 		return "", errors.New("Malformed URL: " + err.Error())
 	}
 
 	params := url.Values{}
-	params.Add("info_hash", "lol") //string(info.InfoHash))
+	// info_hash and peer_id are raw 20-byte strings; url.Values.Encode
+	// percent-encodes every byte that isn't unreserved except a space,
+	// which it writes as '+', so that is rewritten to %20 below -- every
+	// byte then ends up percent-encoded, which is what BEP 3 requires here.
+	params.Add("info_hash", string(info.InfoHash))
 	params.Add("peer_id", peerID)
 	params.Add("port", strconv.Itoa(port))
 	params.Add("compact", "1")
@@ -65,6 +136,6 @@ func prepareURL(initState i.State, peerID string, port int, info *torrent.Info)
 	params.Add("uploaded", strconv.Itoa(initState.Uploaded))
 	params.Add("downloaded", strconv.Itoa(initState.Downloaded))
 	params.Add("left", strconv.Itoa(initState.Left))
-	baseURL.RawQuery = params.Encode()
+	baseURL.RawQuery = strings.ReplaceAll(params.Encode(), "+", "%20")
 	return baseURL.String(), nil
 }
@@ -0,0 +1,10 @@
+package tracker
+
+import "github.com/bkolad/gTorrent/torrent"
+
+// Tracker announces to a single BitTorrent tracker (or, for
+// tieredTracker, the full announce-list) and returns the peers it hands
+// back.
+type Tracker interface {
+	Peers() ([]*torrent.PeerInfo, error)
+}
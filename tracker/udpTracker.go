@@ -0,0 +1,158 @@
+package tracker
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	i "github.com/bkolad/gTorrent/init"
+	"github.com/bkolad/gTorrent/torrent"
+)
+
+// protocolID is the magic connection id constant used to identify a
+// connect request, see BEP 15.
+const protocolID uint64 = 0x41727101980
+
+const (
+	actionConnect  uint32 = 0
+	actionAnnounce uint32 = 1
+)
+
+// udpTracker talks to a BEP 15 UDP tracker.
+type udpTracker struct {
+	addr      string
+	info      *torrent.Info
+	initState i.State
+	peerID    string
+	port      int
+}
+
+func newUDPTracker(addr string, info *torrent.Info, initState i.State, conf i.Configuration) Tracker {
+	return &udpTracker{addr, info, initState, conf.PeerID, conf.Port}
+}
+
+func (t *udpTracker) Peers() ([]*torrent.PeerInfo, error) {
+	conn, err := net.Dial("udp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	connID, err := t.connect(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.announce(conn, connID)
+}
+
+// connect performs the 16-byte connect handshake and returns the
+// connection_id the tracker hands back.
+func (t *udpTracker) connect(conn net.Conn) (uint64, error) {
+	txID := randomUint32()
+
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:8], protocolID)
+	binary.BigEndian.PutUint32(req[8:12], actionConnect)
+	binary.BigEndian.PutUint32(req[12:16], txID)
+
+	rsp, err := sendWithRetry(conn, req, 16)
+	if err != nil {
+		return 0, err
+	}
+
+	if binary.BigEndian.Uint32(rsp[0:4]) != actionConnect {
+		return 0, errors.New("udp tracker: unexpected action in connect response")
+	}
+	if binary.BigEndian.Uint32(rsp[4:8]) != txID {
+		return 0, errors.New("udp tracker: transaction id mismatch")
+	}
+
+	return binary.BigEndian.Uint64(rsp[8:16]), nil
+}
+
+// announce sends the 98-byte announce request and decodes the compact
+// peer list from the response.
+func (t *udpTracker) announce(conn net.Conn, connID uint64) ([]*torrent.PeerInfo, error) {
+	txID := randomUint32()
+
+	req := make([]byte, 98)
+	binary.BigEndian.PutUint64(req[0:8], connID)
+	binary.BigEndian.PutUint32(req[8:12], actionAnnounce)
+	binary.BigEndian.PutUint32(req[12:16], txID)
+	copy(req[16:36], t.info.InfoHash)
+	copy(req[36:56], []byte(t.peerID))
+	binary.BigEndian.PutUint64(req[56:64], uint64(t.initState.Downloaded))
+	binary.BigEndian.PutUint64(req[64:72], uint64(t.initState.Left))
+	binary.BigEndian.PutUint64(req[72:80], uint64(t.initState.Uploaded))
+	binary.BigEndian.PutUint32(req[80:84], 0)              // event: none
+	binary.BigEndian.PutUint32(req[84:88], 0)              // ip: default
+	binary.BigEndian.PutUint32(req[88:92], randomUint32()) // key
+	binary.BigEndian.PutUint32(req[92:96], 0xFFFFFFFF)     // num_want: -1
+	binary.BigEndian.PutUint16(req[96:98], uint16(t.port))
+
+	rsp, err := sendWithRetry(conn, req, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint32(rsp[0:4]) != actionAnnounce {
+		return nil, errors.New("udp tracker: unexpected action in announce response")
+	}
+	if binary.BigEndian.Uint32(rsp[4:8]) != txID {
+		return nil, errors.New("udp tracker: transaction id mismatch")
+	}
+
+	compactPeers := rsp[20:]
+	if len(compactPeers)%6 != 0 {
+		return nil, errors.New("udp tracker: malformed peers list")
+	}
+
+	var peers []*torrent.PeerInfo
+	for i := 0; i+6 <= len(compactPeers); i += 6 {
+		ip := net.IP(compactPeers[i : i+4])
+		port := binary.BigEndian.Uint16(compactPeers[i+4 : i+6])
+		peers = append(peers, &torrent.PeerInfo{IP: ip.String(), Port: int(port)})
+	}
+
+	return peers, nil
+}
+
+// sendWithRetry implements the BEP 15 re-transmission schedule: since UDP
+// is unreliable, a request is resent after 15*2^n seconds, giving up once
+// n reaches 8.
+func sendWithRetry(conn net.Conn, req []byte, minRspLen int) ([]byte, error) {
+	rsp := make([]byte, 2048)
+
+	for n := 0; n <= 8; n++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		timeout := time.Duration(15*(1<<uint(n))) * time.Second
+		conn.SetReadDeadline(time.Now().Add(timeout))
+
+		size, err := conn.Read(rsp)
+		if err == nil {
+			if size < minRspLen {
+				return nil, errors.New("udp tracker: response too short")
+			}
+			return rsp[:size], nil
+		}
+
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("udp tracker: no response from %s after retries", conn.RemoteAddr())
+}
+
+func randomUint32() uint32 {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return binary.BigEndian.Uint32(buf)
+}